@@ -119,6 +119,7 @@ type ConfigInfo struct {
 	DownloadHeaders        []*HTTPOption
 	Headers                []*HTTPOption
 	RefreshTimes           bool
+	ResumeSync             bool // Record completed objects so an interrupted sync can skip them
 }
 
 // NewConfig creates a new config with everything set to the default
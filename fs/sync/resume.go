@@ -0,0 +1,282 @@
+package sync
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// checkpointEntry is a single line in the checkpoint manifest
+type checkpointEntry struct {
+	Remote      string
+	Fingerprint string
+}
+
+// syncCheckpoint records the objects which a sync has finished with
+// so that if the sync is interrupted a re-run can skip them without
+// checking them again.
+//
+// The manifest is a file of JSON lines, one for each completed
+// object, which is appended to as the sync progresses.
+type syncCheckpoint struct {
+	mu      sync.Mutex
+	path    string            // path of the manifest file
+	done    map[string]string // fingerprints of completed objects by remote
+	fd      *os.File          // manifest open for append
+	skipped int               // number of objects skipped as completed
+}
+
+// Absolute checkpoint directories by config.CacheDir
+var (
+	checkpointDirsMu sync.Mutex
+	checkpointDirs   = map[string]string{}
+)
+
+// checkpointDir returns the directory the manifests are stored in.
+//
+// If config.CacheDir is relative this resolves it against the current
+// directory the first time it is seen and remembers the result, so
+// the manifests stay in the same place for every sync in this process
+// even if the current directory changes.
+func checkpointDir() (string, error) {
+	checkpointDirsMu.Lock()
+	defer checkpointDirsMu.Unlock()
+	if dir, ok := checkpointDirs[config.CacheDir]; ok {
+		return dir, nil
+	}
+	dir := filepath.Join(config.CacheDir, "resume-sync")
+	if !filepath.IsAbs(dir) {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to find sync checkpoint directory")
+		}
+		fs.Logf(nil, "Cache directory %q is relative so using %q for sync checkpoints", config.CacheDir, absDir)
+		dir = absDir
+	}
+	checkpointDirs[config.CacheDir] = dir
+	return dir, nil
+}
+
+// checkpointPath returns the path of the manifest for syncing fsrc
+// into fdst
+func checkpointPath(fdst, fsrc fs.Fs) (string, error) {
+	dir, err := checkpointDir()
+	if err != nil {
+		return "", err
+	}
+	key := md5.Sum([]byte(fs.ConfigString(fsrc) + "\n" + fs.ConfigString(fdst)))
+	return filepath.Join(dir, hex.EncodeToString(key[:])), nil
+}
+
+// fixCheckpointRoot makes a local path suitable for prefix comparison
+func fixCheckpointRoot(root string, caseInsensitive bool) string {
+	root = strings.TrimPrefix(filepath.ToSlash(root), "//?/")
+	root = strings.Trim(root, "/")
+	if root != "" {
+		root += "/"
+	}
+	if caseInsensitive {
+		root = strings.ToLower(root)
+	}
+	return root
+}
+
+// checkCheckpointOverlap returns an error if dir overlaps the root of
+// any of the local Fses passed in, since the sync could then transfer
+// or delete the checkpoints, or the checkpoints could end up amongst
+// the user's data.
+func checkCheckpointOverlap(dir string, fses ...fs.Fs) error {
+	for _, f := range fses {
+		features := f.Features()
+		if !features.IsLocal {
+			continue
+		}
+		dirRoot := fixCheckpointRoot(dir, features.CaseInsensitive)
+		fRoot := fixCheckpointRoot(f.Root(), features.CaseInsensitive)
+		if strings.HasPrefix(dirRoot, fRoot) || strings.HasPrefix(fRoot, dirRoot) {
+			return fserrors.FatalError(errors.Errorf("sync checkpoint directory %q overlaps %v - use a different --cache-dir with --resume-sync", dir, f))
+		}
+	}
+	return nil
+}
+
+// checkCheckpointDir returns an error if the checkpoint directory for
+// syncing fsrc into fdst can't be used. This is called before the
+// sync starts so nothing is touched if it fails.
+func checkCheckpointDir(fdst, fsrc fs.Fs) error {
+	path, err := checkpointPath(fdst, fsrc)
+	if err != nil {
+		return err
+	}
+	return checkCheckpointOverlap(filepath.Dir(path), fdst, fsrc)
+}
+
+// newSyncCheckpoint opens the checkpoint manifest for syncing fsrc
+// into fdst, reading any objects completed by a previous interrupted
+// run.
+func newSyncCheckpoint(fdst, fsrc fs.Fs) (*syncCheckpoint, error) {
+	path, err := checkpointPath(fdst, fsrc)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCheckpointOverlap(filepath.Dir(path), fdst, fsrc)
+	if err != nil {
+		return nil, err
+	}
+	c := &syncCheckpoint{
+		path: path,
+		done: make(map[string]string),
+	}
+	err = c.read()
+	if err != nil {
+		return nil, err
+	}
+	if len(c.done) > 0 {
+		fs.Infof(fdst, "Resuming sync: %d objects already transferred", len(c.done))
+	}
+	err = os.MkdirAll(filepath.Dir(c.path), 0700)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to make sync checkpoint directory")
+	}
+	c.fd, err = os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open sync checkpoint")
+	}
+	return c, nil
+}
+
+// read the manifest from disk if it exists
+func (c *syncCheckpoint) read() (err error) {
+	fd, err := os.Open(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read sync checkpoint")
+	}
+	defer fs.CheckClose(fd, &err)
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		var entry checkpointEntry
+		// The last line may have been truncated if we were
+		// interrupted while writing it so ignore bad lines
+		if jsonErr := json.Unmarshal(scanner.Bytes(), &entry); jsonErr != nil {
+			fs.Debugf(nil, "Ignoring corrupt sync checkpoint entry: %v", jsonErr)
+			continue
+		}
+		c.done[entry.Remote] = entry.Fingerprint
+	}
+	if err = scanner.Err(); err != nil {
+		return errors.Wrap(err, "failed to read sync checkpoint")
+	}
+	return nil
+}
+
+// checkpointFingerprint returns a fingerprint of src made from the
+// attributes which are cheap to read, like fs.Fingerprint with fast
+// set.
+//
+// If neither the modification time nor a hash is cheap to read (eg S3
+// objects without an MD5) then the size alone can't tell whether src
+// has changed so this returns "" and src is always checked.
+func checkpointFingerprint(ctx context.Context, src fs.ObjectInfo) string {
+	var (
+		out      strings.Builder
+		useful   bool
+		f        = src.Fs()
+		features = f.Features()
+	)
+	fmt.Fprintf(&out, "%d", src.Size())
+	if !features.SlowModTime && f.Precision() != fs.ModTimeNotSupported {
+		fmt.Fprintf(&out, ",%v", src.ModTime(ctx).UTC())
+		useful = true
+	}
+	if !features.SlowHash {
+		hashType := f.Hashes().GetOne()
+		if hashType != hash.None {
+			sum, err := src.Hash(ctx, hashType)
+			if err == nil && sum != "" {
+				fmt.Fprintf(&out, ",%v", sum)
+				useful = true
+			}
+		}
+	}
+	if !useful {
+		return ""
+	}
+	return out.String()
+}
+
+// completed returns true if src was transferred by a previous run
+// and hasn't changed since
+func (c *syncCheckpoint) completed(ctx context.Context, src fs.Object) bool {
+	c.mu.Lock()
+	fingerprint, ok := c.done[src.Remote()]
+	c.mu.Unlock()
+	if !ok || fingerprint == "" || fingerprint != checkpointFingerprint(ctx, src) {
+		return false
+	}
+	c.mu.Lock()
+	c.skipped++
+	c.mu.Unlock()
+	return true
+}
+
+// add records src as completed
+func (c *syncCheckpoint) add(ctx context.Context, src fs.Object) {
+	entry := checkpointEntry{
+		Remote:      src.Remote(),
+		Fingerprint: checkpointFingerprint(ctx, src),
+	}
+	if entry.Fingerprint == "" {
+		// No point recording an object which will always be checked
+		return
+	}
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		fs.Errorf(src, "Failed to encode sync checkpoint entry: %v", err)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done[entry.Remote] = entry.Fingerprint
+	_, err = c.fd.Write(append(data, '\n'))
+	if err != nil {
+		fs.Errorf(src, "Failed to write sync checkpoint entry: %v", err)
+	}
+}
+
+// finish closes the manifest, removing it if the sync succeeded so
+// the next run starts afresh.
+func (c *syncCheckpoint) finish(success bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.skipped > 0 {
+		fs.Infof(nil, "Resumed sync: skipped %d objects already transferred", c.skipped)
+	}
+	err := c.fd.Close()
+	if err != nil {
+		fs.Errorf(nil, "Failed to close sync checkpoint: %v", err)
+	}
+	if !success {
+		fs.Debugf(nil, "Keeping sync checkpoint %q for --resume-sync", c.path)
+		return
+	}
+	err = os.Remove(c.path)
+	if err != nil && !os.IsNotExist(err) {
+		fs.Errorf(nil, "Failed to remove sync checkpoint: %v", err)
+	}
+}
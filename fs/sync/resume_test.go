@@ -0,0 +1,142 @@
+package sync
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpointPathRelativeCacheDir(t *testing.T) {
+	oldCacheDir := config.CacheDir
+	defer func() {
+		config.CacheDir = oldCacheDir
+	}()
+	fsrc := mockfs.NewFs("src", "dir")
+	fdst := mockfs.NewFs("dst", "dir")
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	config.CacheDir = filepath.Join("relative", "cache")
+	path, err := checkpointPath(fdst, fsrc)
+	require.NoError(t, err)
+	assert.True(t, filepath.IsAbs(path))
+	assert.Equal(t, filepath.Join(cwd, "relative", "cache", "resume-sync"), filepath.Dir(path))
+
+	// An empty cache dir resolves to the current directory
+	config.CacheDir = ""
+	path, err = checkpointPath(fdst, fsrc)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(cwd, "resume-sync"), filepath.Dir(path))
+
+	// An absolute cache dir is used as is
+	config.CacheDir = filepath.Join(cwd, "abs")
+	path, err = checkpointPath(fdst, fsrc)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(cwd, "abs", "resume-sync"), filepath.Dir(path))
+
+	// A relative cache dir resolves to the same place after
+	// changing directory
+	config.CacheDir = filepath.Join("relative", "cache")
+	tmpDir, err := ioutil.TempDir("", "rclone-resume-sync")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tmpDir))
+	}()
+	require.NoError(t, os.Chdir(tmpDir))
+	defer func() {
+		require.NoError(t, os.Chdir(cwd))
+	}()
+	path, err = checkpointPath(fdst, fsrc)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(cwd, "relative", "cache", "resume-sync"), filepath.Dir(path))
+}
+
+func TestFixCheckpointRoot(t *testing.T) {
+	for _, test := range []struct {
+		root            string
+		caseInsensitive bool
+		want            string
+	}{
+		{"", false, ""},
+		{"/", false, ""},
+		{"/tmp/dir", false, "tmp/dir/"},
+		{"/tmp/dir/", false, "tmp/dir/"},
+		{"/tmp/Dir", true, "tmp/dir/"},
+		{"//?/C:/Dir", false, "C:/Dir/"},
+	} {
+		got := fixCheckpointRoot(test.root, test.caseInsensitive)
+		assert.Equal(t, test.want, got, test.root)
+	}
+}
+
+func TestCheckpointCompleted(t *testing.T) {
+	ctx := context.Background()
+	cacheDir, err := ioutil.TempDir("", "rclone-resume-sync")
+	require.NoError(t, err)
+	oldCacheDir := config.CacheDir
+	config.CacheDir = cacheDir
+	defer func() {
+		config.CacheDir = oldCacheDir
+		require.NoError(t, os.RemoveAll(cacheDir))
+	}()
+
+	for _, test := range []struct {
+		name        string
+		slowModTime bool
+		hashes      hash.Set
+		wantSkip    bool
+		seesContent bool // whether a change of content with the same size and modtime is noticed
+	}{
+		{"ModTimeOnly", false, hash.Set(hash.None), true, false},
+		{"HashOnly", true, hash.Set(hash.MD5), true, true},
+		{"SizeOnly", true, hash.Set(hash.None), false, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fsrc := mockfs.NewFs("src", test.name)
+			fsrc.Features().SlowModTime = test.slowModTime
+			fsrc.SetHashes(test.hashes)
+			fdst := mockfs.NewFs("dst", test.name)
+
+			newObject := func(content string) fs.Object {
+				o := mockobject.New("file").WithContent([]byte(content), mockobject.SeekModeNone)
+				o.SetFs(fsrc)
+				return o
+			}
+			original := newObject("aaa")
+			changed := newObject("bbb")
+
+			c, err := newSyncCheckpoint(fdst, fsrc)
+			require.NoError(t, err)
+			c.add(ctx, original)
+			c.finish(false)
+
+			// Re-open the checkpoint as a resumed sync would
+			c, err = newSyncCheckpoint(fdst, fsrc)
+			require.NoError(t, err)
+			defer c.finish(true)
+			assert.Equal(t, test.wantSkip, c.completed(ctx, original))
+			wantSkipped := 0
+			if test.wantSkip {
+				wantSkipped = 1
+			}
+
+			// A changed source of the same size must not be
+			// skipped unless only its modtime can be compared
+			if test.seesContent {
+				assert.False(t, c.completed(ctx, changed))
+				assert.Equal(t, wantSkipped, c.skipped)
+			}
+		})
+	}
+}
@@ -69,6 +69,7 @@ type syncCopyMove struct {
 	compareCopyDest        fs.Fs                  // place to check for files to server side copy
 	backupDir              fs.Fs                  // place to store overwrites/deletes
 	checkFirst             bool                   // if set run all the checkers before starting transfers
+	checkpoint             *syncCheckpoint        // completed objects for --resume-sync, nil if not in use
 }
 
 type trackRenamesStrategy byte
@@ -330,7 +331,11 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 				// If moving need to delete the files we don't need to copy
 				if s.DoMove {
 					// Delete src if no error on copy
-					s.processError(operations.DeleteFile(s.ctx, src))
+					err = operations.DeleteFile(s.ctx, src)
+					s.processError(err)
+				}
+				if err == nil && s.checkpoint != nil {
+					s.checkpoint.add(s.ctx, src)
 				}
 			}
 		}
@@ -374,6 +379,9 @@ func (s *syncCopyMove) pairCopyOrMove(ctx context.Context, in *pipe, fdst fs.Fs,
 			_, err = operations.Copy(ctx, fdst, pair.Dst, src.Remote(), src)
 		}
 		s.processError(err)
+		if err == nil && s.checkpoint != nil {
+			s.checkpoint.add(ctx, src)
+		}
 	}
 }
 
@@ -796,6 +804,17 @@ func (s *syncCopyMove) run() error {
 		return nil
 	}
 
+	// Open the checkpoint for --resume-sync if required now we know
+	// the sync will run. The delete only pass doesn't transfer
+	// anything so doesn't need it.
+	if fs.Config.ResumeSync && !fs.Config.DryRun && s.deleteMode != fs.DeleteModeOnly {
+		var err error
+		s.checkpoint, err = newSyncCheckpoint(s.fdst, s.fsrc)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Start background checking and transferring pipeline
 	s.startCheckers()
 	s.startRenamers()
@@ -876,6 +895,10 @@ func (s *syncCopyMove) run() error {
 	// Read the error out of the context if there is one
 	s.processError(s.ctx.Err())
 
+	if s.checkpoint != nil {
+		s.checkpoint.finish(s.currentError() == nil)
+	}
+
 	if s.deleteMode != fs.DeleteModeOnly && accounting.Stats(s.ctx).GetTransfers() == 0 {
 		fs.Infof(nil, "There was nothing to transfer")
 	}
@@ -985,6 +1008,11 @@ func (s *syncCopyMove) Match(ctx context.Context, dst, src fs.DirEntry) (recurse
 		}
 		dstX, ok := dst.(fs.Object)
 		if ok {
+			// Skip objects finished by an interrupted sync
+			if s.checkpoint != nil && s.checkpoint.completed(s.ctx, srcX) {
+				fs.Debugf(srcX, "Skipping as already transferred by interrupted sync")
+				return false
+			}
 			ok = s.toBeChecked.Put(s.ctx, fs.ObjectPair{Src: srcX, Dst: dstX})
 			if !ok {
 				return false
@@ -1031,6 +1059,14 @@ func runSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 	if deleteMode != fs.DeleteModeOff && DoMove {
 		return fserrors.FatalError(errors.New("can't delete and move at the same time"))
 	}
+	// Check the --resume-sync checkpoint can be used before any pass
+	// touches the destination
+	if fs.Config.ResumeSync && !fs.Config.DryRun {
+		err := checkCheckpointDir(fdst, fsrc)
+		if err != nil {
+			return err
+		}
+	}
 	// Run an extra pass to delete only
 	if deleteMode == fs.DeleteModeBefore {
 		if fs.Config.TrackRenames {
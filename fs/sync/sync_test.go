@@ -5,6 +5,9 @@ package sync
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
@@ -14,6 +17,7 @@ import (
 	_ "github.com/rclone/rclone/backend/all" // import all backends
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/hash"
@@ -1886,3 +1890,127 @@ func TestAbort(t *testing.T) {
 	fserrors.Count(expectedErr)
 	assert.Equal(t, expectedErr, err)
 }
+
+// Test that --resume-sync skips objects finished by an interrupted sync
+func TestSyncResume(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+
+	if r.Fremote.Name() != "local" {
+		t.Skip("This test only runs on local")
+	}
+
+	cacheDir, err := ioutil.TempDir("", "rclone-resume-sync")
+	require.NoError(t, err)
+	oldCacheDir := config.CacheDir
+	oldResumeSync := fs.Config.ResumeSync
+	oldMaxTransfer := fs.Config.MaxTransfer
+	oldTransfers := fs.Config.Transfers
+	oldCheckers := fs.Config.Checkers
+	config.CacheDir = cacheDir
+	fs.Config.ResumeSync = true
+	fs.Config.MaxTransfer = 3 * 1024
+	fs.Config.Transfers = 1
+	fs.Config.Checkers = 1
+	defer func() {
+		config.CacheDir = oldCacheDir
+		fs.Config.ResumeSync = oldResumeSync
+		fs.Config.MaxTransfer = oldMaxTransfer
+		fs.Config.Transfers = oldTransfers
+		fs.Config.Checkers = oldCheckers
+		require.NoError(t, os.RemoveAll(cacheDir))
+	}()
+
+	file1 := r.WriteFile("file1", string(make([]byte, 1*1024)), t1)
+	file2 := r.WriteFile("file2", string(make([]byte, 5*1024)), t1)
+	file3 := r.WriteFile("file3", string(make([]byte, 1*1024)), t1)
+	fstest.CheckItems(t, r.Flocal, file1, file2, file3)
+	fstest.CheckItems(t, r.Fremote)
+
+	// Interrupt the sync with --max-transfer part way through file2
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(context.Background(), r.Fremote, r.Flocal, false)
+	require.Error(t, err)
+	fstest.CheckItems(t, r.Fremote, file1)
+
+	checkpoint, err := checkpointPath(r.Fremote, r.Flocal)
+	require.NoError(t, err)
+	_, err = os.Stat(checkpoint)
+	require.NoError(t, err, "checkpoint should be kept after an interrupted sync")
+
+	// Re-run the sync which should skip file1 without checking it
+	fs.Config.MaxTransfer = -1
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(context.Background(), r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+	fstest.CheckItems(t, r.Fremote, file1, file2, file3)
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetChecks())
+	assert.Equal(t, int64(2), accounting.GlobalStats().GetTransfers())
+
+	_, err = os.Stat(checkpoint)
+	assert.True(t, os.IsNotExist(err), "checkpoint should be removed after a successful sync")
+
+	// Syncs which fail to start or have nothing to do shouldn't
+	// leave a checkpoint behind
+	fs.Config.CopyDest = "nonexistent-remote:"
+	err = CopyDir(context.Background(), r.Fremote, r.Flocal, false)
+	fs.Config.CopyDest = ""
+	require.Error(t, err)
+	err = CopyDir(context.Background(), r.Fremote, r.Fremote, false)
+	require.NoError(t, err)
+	entries, err := ioutil.ReadDir(filepath.Dir(checkpoint))
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(entries), "no checkpoint should be left behind")
+}
+
+// Test that --resume-sync refuses a cache dir inside the sync
+func TestSyncResumeOverlap(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+
+	if r.Fremote.Name() != "local" {
+		t.Skip("This test only runs on local")
+	}
+
+	oldCacheDir := config.CacheDir
+	oldResumeSync := fs.Config.ResumeSync
+	fs.Config.ResumeSync = true
+	defer func() {
+		config.CacheDir = oldCacheDir
+		fs.Config.ResumeSync = oldResumeSync
+	}()
+
+	file1 := r.WriteFile("file1", "file1 contents", t1)
+	fstest.CheckItems(t, r.Flocal, file1)
+
+	for _, f := range []fs.Fs{r.Flocal, r.Fremote} {
+		// cache dir inside the root
+		config.CacheDir = filepath.Join(filepath.FromSlash(f.Root()), "cache")
+		err := Sync(context.Background(), r.Fremote, r.Flocal, false)
+		require.Error(t, err)
+		assert.True(t, fserrors.IsFatalError(err))
+		assert.Contains(t, err.Error(), "overlaps")
+
+		// cache dir the same as the root
+		config.CacheDir = filepath.FromSlash(f.Root())
+		err = Sync(context.Background(), r.Fremote, r.Flocal, false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "overlaps")
+	}
+	fstest.CheckItems(t, r.Fremote)
+
+	// --delete-before must refuse before deleting anything
+	oldDeleteMode := fs.Config.DeleteMode
+	fs.Config.DeleteMode = fs.DeleteModeBefore
+	defer func() {
+		fs.Config.DeleteMode = oldDeleteMode
+	}()
+	file2 := r.WriteObject(context.Background(), "file2", "dst only", t1)
+	fstest.CheckItems(t, r.Fremote, file2)
+	config.CacheDir = filepath.FromSlash(r.Fremote.Root())
+	err := Sync(context.Background(), r.Fremote, r.Flocal, false)
+	require.Error(t, err)
+	assert.True(t, fserrors.IsFatalError(err))
+	assert.Contains(t, err.Error(), "overlaps")
+	fstest.CheckItems(t, r.Fremote, file2)
+}